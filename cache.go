@@ -0,0 +1,79 @@
+package qcow2
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a fixed-capacity, concurrency-safe LRU keyed by K. Capacity
+// is expressed in whatever unit cost returns for a value (e.g. one per
+// entry, or a byte count); once the tracked total would exceed capacity,
+// the least-recently-used values are evicted. The most recently added
+// value is always kept, so a single value whose cost alone exceeds
+// capacity stays cached and the total is then above capacity. A
+// capacity <= 0 disables the cache: add becomes a no-op and get always
+// misses.
+type lruCache[K comparable, V any] struct {
+	capacity int
+	cost     func(V) int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	size  int
+}
+
+type lruCacheEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUCache[K comparable, V any](capacity int, cost func(V) int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		cost:     cost,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruCacheEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) add(key K, value V) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruCacheEntry[K, V])
+		c.size += c.cost(value) - c.cost(entry.value)
+		entry.value = value
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(&lruCacheEntry[K, V]{key: key, value: value})
+		c.items[key] = el
+		c.size += c.cost(value)
+	}
+
+	for c.size > c.capacity && c.ll.Len() > 1 {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		entry := oldest.Value.(*lruCacheEntry[K, V])
+		delete(c.items, entry.key)
+		c.size -= c.cost(entry.value)
+	}
+}
@@ -0,0 +1,53 @@
+package qcow2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUCache[int, int](2, func(int) int { return 1 })
+
+	c.add(1, 10)
+	c.add(2, 20)
+
+	// Touch 1 so 2 becomes the least recently used.
+	_, ok := c.get(1)
+	require.True(t, ok)
+
+	c.add(3, 30)
+
+	_, ok = c.get(2)
+	require.False(t, ok, "least recently used entry should have been evicted")
+
+	v, ok := c.get(1)
+	require.True(t, ok)
+	require.Equal(t, 10, v)
+
+	v, ok = c.get(3)
+	require.True(t, ok)
+	require.Equal(t, 30, v)
+}
+
+func TestLRUCacheZeroCapacityDisablesCaching(t *testing.T) {
+	c := newLRUCache[int, int](0, func(int) int { return 1 })
+
+	c.add(1, 10)
+
+	_, ok := c.get(1)
+	require.False(t, ok)
+}
+
+func TestLRUCacheEvictsByCost(t *testing.T) {
+	c := newLRUCache[int, []byte](10, func(v []byte) int { return len(v) })
+
+	c.add(1, make([]byte, 6))
+	c.add(2, make([]byte, 6))
+
+	_, ok := c.get(1)
+	require.False(t, ok, "adding the second entry should have evicted the first to stay under the byte budget")
+
+	_, ok = c.get(2)
+	require.True(t, ok)
+}
@@ -7,18 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // QCOW2 reader
 //
-// Missing features:
-// - extended L2 entries
-// - zstd decompression
-//
 // Missing features that probably are not going to be implemented ever:
 // - reading dirty/corrupted images
 // - reading encrypted images
-// - reading images with backing files
 // - reading images with external data files
 //
 // QCOW2 spec: https://gitlab.com/qemu-project/qemu/-/blob/master/docs/interop/qcow2.txt
@@ -53,6 +51,22 @@ type qcow2Config struct {
 
 	// See Compressed Clusters Descriptor in qcow2.txt
 	l2CompressedEntryHostClusterOffsetMask uint64
+
+	// whether L2 entries are the extended (16-byte, with a subcluster
+	// allocation bitmap) format rather than the standard 8-byte one
+	extendedL2 bool
+
+	// total size of the image file, used to bound reads of compressed
+	// clusters whose compressed length is not recorded in the L2 entry
+	imageSize int64
+
+	// decompresses compressed clusters; selected from the header's
+	// compression type
+	decompressor decompressor
+
+	// backing image to read unallocated clusters from, or nil if this
+	// image has no backing file
+	backing *Image
 }
 
 type qcow2Reader struct {
@@ -63,13 +77,22 @@ type qcow2Reader struct {
 	// cluster currently being read
 	currentCluster int
 
-	// L2 table that corresponds to currentCluster
-	currentL2Table []l2Entry
+	// L2 table that corresponds to currentCluster, and the L1 index it
+	// was loaded for (-1 if none loaded yet)
+	currentL2Table    []l2Entry
+	currentL2TableIdx int
 
 	// current cluster data, clusterSize-sized
 	currentData []byte
 	// read offset in current cluster data
 	currentOffset int
+
+	// absolute byte position, kept in sync with currentCluster/currentOffset
+	pos int64
+
+	// offset within the next cluster fillNextCluster loads, set by Seek
+	// when it has to defer the actual load to the next read
+	seekOffset int
 }
 
 const l1EntryOffsetMask = 0xfffffffffffe00 // bits 9-55
@@ -100,9 +123,17 @@ const (
 	incFeatUnknownBits          = ^uint64(0b11111)
 
 	compressionTypeZlib = 0
+	compressionTypeZstd = 1
 )
 
-func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
+// maxBackingChainDepth bounds how many backing files parseHeaderAndL1
+// will follow before giving up. Images are untrusted input to this
+// reader, so a backing chain that loops back on itself (accidentally or
+// otherwise) must fail cleanly instead of recursing until the stack
+// overflows.
+const maxBackingChainDepth = 32
+
+func parseHeaderAndL1(image io.ReadSeeker, resolver BackingResolver, depth int) (qcow2Config, error) {
 	header := make([]byte, 72)
 	if _, err := io.ReadFull(image, header); err != nil {
 		return qcow2Config{}, err
@@ -117,12 +148,34 @@ func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
 		return qcow2Config{}, fmt.Errorf("version %d is not supported", ver)
 	}
 
-	backingFileNameOffset := binary.BigEndian.Uint64(header[8:16])
+	backingFileNameOffset := int64(binary.BigEndian.Uint64(header[8:16]))
+	backingFileNameSize := binary.BigEndian.Uint32(header[16:20])
+
+	var backing *Image
 	if backingFileNameOffset != 0 {
-		return qcow2Config{}, errors.New("backing file is not supported")
-	}
+		if resolver == nil {
+			return qcow2Config{}, errors.New("image has a backing file but no BackingResolver was provided")
+		}
 
-	// skip backing file name size
+		if depth >= maxBackingChainDepth {
+			return qcow2Config{}, fmt.Errorf("backing file chain is more than %d deep, probably a cycle", maxBackingChainDepth)
+		}
+
+		name, err := readBackingFileName(image, backingFileNameOffset, backingFileNameSize)
+		if err != nil {
+			return qcow2Config{}, fmt.Errorf("failed to read backing file name: %w", err)
+		}
+
+		backingImage, err := resolver.Open(name)
+		if err != nil {
+			return qcow2Config{}, fmt.Errorf("failed to open backing file %q: %w", name, err)
+		}
+
+		backing, err = newReaderWithOptions(backingImage, Options{BackingResolver: resolver}, depth+1)
+		if err != nil {
+			return qcow2Config{}, fmt.Errorf("failed to parse backing file %q: %w", name, err)
+		}
+	}
 
 	clusterBits := binary.BigEndian.Uint32(header[20:24])
 	if clusterBits < 9 || clusterBits > 21 {
@@ -145,6 +198,9 @@ func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
 	// skip num snapshots
 	// skip snapshots offset
 
+	compressionType := compressionTypeZlib
+	extendedL2 := false
+
 	if ver == 3 {
 		v3Header := make([]byte, 32)
 		if _, err := io.ReadFull(image, v3Header); err != nil {
@@ -165,10 +221,7 @@ func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
 		}
 
 		hasNonDefaultCompression := incompatibleFeatures&incFeatCompressionTypeBit != 0
-
-		if incompatibleFeatures&incFeatExtendedL2EntriesBit != 0 {
-			return qcow2Config{}, errors.New("extended L2 entries are not supported")
-		}
+		extendedL2 = incompatibleFeatures&incFeatExtendedL2EntriesBit != 0
 
 		if incompatibleFeatures&incFeatUnknownBits != 0 {
 			return qcow2Config{}, fmt.Errorf("unknown incompatible features are not supported, got 0x%x", incompatibleFeatures&incFeatUnknownBits)
@@ -201,21 +254,34 @@ func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
 				return qcow2Config{}, fmt.Errorf("too short header for non-default compression expect header length, expected >=108, got %d", headerLength)
 			}
 
-			compressionType := binary.BigEndian.Uint32(v3Header[0:4])
-			if compressionType != compressionTypeZlib {
-				return qcow2Config{}, fmt.Errorf("compression type %d is not supported", compressionType)
-			}
+			compressionType = int(additionalFields[0])
 		}
 
 		// skip padding & header extensions
 	}
 
+	decomp, err := newDecompressor(compressionType)
+	if err != nil {
+		return qcow2Config{}, err
+	}
+
 	l1Table, err := parseL1Table(image, l1TableOffset, l1TableSize)
 	if err != nil {
 		return qcow2Config{}, fmt.Errorf("failed to read L1 table: %w", err)
 	}
 
+	imageSize, err := image.Seek(0, io.SeekEnd)
+	if err != nil {
+		return qcow2Config{}, fmt.Errorf("failed to determine image size: %w", err)
+	}
+
+	// A standard L2 entry is 8 bytes; an extended one doubles that with a
+	// subcluster allocation bitmap, halving how many entries fit in a
+	// cluster-sized L2 table.
 	l2TableSize := clusterSize / 8
+	if extendedL2 {
+		l2TableSize = clusterSize / 16
+	}
 
 	return qcow2Config{
 		clusterSize: clusterSize,
@@ -223,15 +289,109 @@ func parseHeaderAndL1(image io.ReadSeeker) (qcow2Config, error) {
 		l2TableSize: l2TableSize,
 		// See Compressed Clusters Descriptor in qcow2.txt
 		l2CompressedEntryHostClusterOffsetMask: 1<<(70-clusterBits) - 1,
+		extendedL2:                             extendedL2,
+
+		imageSize:    imageSize,
+		decompressor: decomp,
+		backing:      backing,
 
 		l1Table: l1Table,
 	}, nil
 }
 
+// BackingResolver opens the backing file an image's header refers to, by
+// the name recorded there. Implementations typically resolve the name
+// relative to the directory holding the overlay image, matching how
+// qemu-img interprets it.
+type BackingResolver interface {
+	Open(name string) (io.ReadSeeker, error)
+}
+
+// readBackingFileName reads the backing file name stored at [offset,
+// offset+size) and restores image's position to where it was before the
+// call, so header parsing can continue sequentially.
+func readBackingFileName(image io.ReadSeeker, offset int64, size uint32) (string, error) {
+	pos, err := image.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := image.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	name := make([]byte, size)
+	if _, err := io.ReadFull(image, name); err != nil {
+		return "", err
+	}
+
+	if _, err := image.Seek(pos, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return string(name), nil
+}
+
+// decompressor decodes exactly len(out) bytes of one compressed cluster's
+// payload, read from r, into out.
+type decompressor interface {
+	decompress(r io.Reader, out []byte) error
+}
+
+func newDecompressor(compressionType int) (decompressor, error) {
+	switch compressionType {
+	case compressionTypeZlib:
+		return zlibDecompressor{}, nil
+	case compressionTypeZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decompressor: %w", err)
+		}
+		return &zstdDecompressor{dec: dec}, nil
+	default:
+		return nil, fmt.Errorf("compression type %d is not supported", compressionType)
+	}
+}
+
+type zlibDecompressor struct{}
+
+func (zlibDecompressor) decompress(r io.Reader, out []byte) error {
+	flateReader := flate.NewReader(r)
+	defer flateReader.Close()
+
+	_, err := io.ReadFull(flateReader, out)
+	return err
+}
+
+// zstdDecompressor reuses a single *zstd.Decoder across clusters, since
+// constructing one is expensive. Each compressed cluster is a
+// self-contained zstd frame, so Reset just re-synchronizes the decoder
+// to the start of the next frame.
+type zstdDecompressor struct {
+	dec *zstd.Decoder
+}
+
+func (z *zstdDecompressor) decompress(r io.Reader, out []byte) error {
+	if err := z.dec.Reset(r); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(z.dec, out)
+	return err
+}
+
 type l2Entry struct {
 	offset     int64
 	compressed bool
 	allZeroes  bool
+
+	// Subcluster allocation state for extended L2 entries, one bit per
+	// subcluster (bit i describes subcluster i). Unset in both masks for
+	// all non-extended L2 tables, and for compressed entries, which
+	// don't carry subcluster information. A subcluster with neither bit
+	// set is unallocated: it reads from the backing image if there is
+	// one, and as zero otherwise.
+	subclusterAllocated uint32
+	subclusterAllZeroes uint32
 }
 
 const (
@@ -239,85 +399,236 @@ const (
 
 	l2EntryNoncompressedAllZeroesBit = 1 << 0
 	l2EntryNoncompressedOffsetMask   = 0xfffffffffffe00 // bits 9-55
+
+	// Extended L2 entries devote their high 64 bits to two 32-bit planes,
+	// one bit per subcluster each. See Subcluster allocation metadata in
+	// qcow2.txt.
+	l2SubclusterCount = 32
 )
 
-func parseL2Table(r *qcow2Reader, l2TableIdx int) error {
-	if r.l1Table[l2TableIdx] == 0 {
-		for i := 0; i < r.l2TableSize; i++ {
-			r.currentL2Table[i] = l2Entry{allZeroes: true}
-		}
-		return nil
+// parseL2Table reads and parses the L2 table at l1Table[l2TableIdx]. It is
+// shared by the sequential qcow2Reader and the random-access Image.
+func parseL2Table(image io.ReadSeeker, cfg qcow2Config, l2TableIdx int) ([]l2Entry, error) {
+	entries := make([]l2Entry, cfg.l2TableSize)
+
+	if cfg.l1Table[l2TableIdx] == 0 {
+		// No L2 table at all: every cluster it would have covered is
+		// unallocated. entries is already all zero-value l2Entrys, i.e.
+		// unallocated (offset 0, not allZeroes) entries, so readCluster
+		// will fall back to the backing image if there is one.
+		return entries, nil
 	}
 
-	if _, err := r.image.Seek(r.l1Table[l2TableIdx], io.SeekStart); err != nil {
-		return err
+	if _, err := image.Seek(cfg.l1Table[l2TableIdx], io.SeekStart); err != nil {
+		return nil, err
 	}
 
 	// last L2 table may be shorter than l2TableSize
-	l2Entries := min(r.l2TableSize, r.nClusters-r.currentCluster)
+	l2Entries := min(cfg.l2TableSize, cfg.nClusters-l2TableIdx*cfg.l2TableSize)
+	entries = entries[:l2Entries]
+
+	// Extended L2 entries are 16 bytes: the standard 8-byte offset/flags
+	// word, followed by an 8-byte subcluster allocation bitmap.
+	entrySize := 8
+	if cfg.extendedL2 {
+		entrySize = 16
+	}
 
-	buf := make([]byte, 8*l2Entries, 8*l2Entries)
-	if _, err := io.ReadFull(r.image, buf); err != nil {
-		return err
+	buf := make([]byte, entrySize*l2Entries)
+	if _, err := io.ReadFull(image, buf); err != nil {
+		return nil, err
 	}
 
 	for i := 0; i < l2Entries; i++ {
-		entry := binary.BigEndian.Uint64(buf[i*8:])
-
-		if entry&l2EntryCompressedBit != 0 {
-			offset := int64(entry & r.l2CompressedEntryHostClusterOffsetMask)
-			r.currentL2Table[i] = l2Entry{offset: offset, compressed: true}
-		} else {
-			if entry&l2EntryNoncompressedAllZeroesBit != 0 {
-				r.currentL2Table[i] = l2Entry{allZeroes: true}
-			} else {
-				r.currentL2Table[i] = l2Entry{offset: int64(entry & l2EntryNoncompressedOffsetMask)}
+		raw := binary.BigEndian.Uint64(buf[i*entrySize:])
+
+		var e l2Entry
+		switch {
+		case raw&l2EntryCompressedBit != 0:
+			e = l2Entry{offset: int64(raw & cfg.l2CompressedEntryHostClusterOffsetMask), compressed: true}
+		case raw&l2EntryNoncompressedAllZeroesBit != 0:
+			e = l2Entry{allZeroes: true}
+		default:
+			e = l2Entry{offset: int64(raw & l2EntryNoncompressedOffsetMask)}
+		}
+
+		if cfg.extendedL2 && !e.compressed {
+			bitmap := binary.BigEndian.Uint64(buf[i*entrySize+8:])
+			allocated, allZeroes, err := parseSubclusterBitmap(bitmap)
+			if err != nil {
+				return nil, fmt.Errorf("L2 entry %d: %w", i, err)
 			}
+			e.subclusterAllocated = allocated
+			e.subclusterAllZeroes = allZeroes
 		}
+
+		entries[i] = e
 	}
 
-	return nil
+	return entries, nil
 }
 
-func fillNextCluster(r *qcow2Reader) error {
-	r.currentCluster++
-	if r.currentCluster == r.nClusters {
-		return io.EOF
+// parseSubclusterBitmap decodes an extended L2 entry's subcluster
+// allocation bitmap: bits 0-31 are the allocation status of the 32
+// subclusters (bit i set means subcluster i's data lives at the entry's
+// offset plus the subcluster's byte range), and bits 32-63 are their
+// all-zeroes status (bit 32+i set means subcluster i reads as zero). A
+// subcluster with neither bit set is unallocated and reads from the
+// backing image if there is one, as zero otherwise. A subcluster must
+// not have both bits set.
+func parseSubclusterBitmap(bitmap uint64) (allocated, allZeroes uint32, err error) {
+	allocated = uint32(bitmap)
+	allZeroes = uint32(bitmap >> l2SubclusterCount)
+
+	if both := allocated & allZeroes; both != 0 {
+		return 0, 0, fmt.Errorf("subclusters 0x%08x are marked both allocated and all-zeroes", both)
 	}
 
-	// If reader has moved from one L2 table to another, parse the new table
-	if r.currentCluster%r.l2TableSize == 0 {
-		if err := parseL2Table(r, r.currentCluster/r.l2TableSize); err != nil {
-			return err
-		}
-	}
+	return allocated, allZeroes, nil
+}
 
-	entry := r.currentL2Table[r.currentCluster%r.l2TableSize]
+// readCluster fills out (one clusterSize-sized buffer) with the decoded
+// contents of clusterIdx, described by entry, reading from image as
+// needed. It is shared by the sequential qcow2Reader and the
+// random-access Image.
+func readCluster(image io.ReadSeeker, cfg qcow2Config, entry l2Entry, clusterIdx int, out []byte) error {
 	switch {
 	case entry.allZeroes:
-		for i := 0; i < r.clusterSize; i++ {
-			r.currentData[i] = 0
+		for i := range out {
+			out[i] = 0
 		}
 	case entry.compressed:
-		if _, err := r.image.Seek(entry.offset, io.SeekStart); err != nil {
+		if _, err := image.Seek(entry.offset, io.SeekStart); err != nil {
 			return err
 		}
-		flateReader := flate.NewReader(r.image)
-		defer flateReader.Close()
 
-		if _, err := io.ReadFull(flateReader, r.currentData); err != nil {
+		// The L2 entry doesn't record how many compressed bytes the
+		// cluster takes up, only where it starts, so bound the reader
+		// by the rest of the image rather than handing the decompressor
+		// an unbounded stream.
+		section := io.LimitReader(image, cfg.imageSize-entry.offset)
+		if err := cfg.decompressor.decompress(section, out); err != nil {
+			return err
+		}
+	case cfg.extendedL2 && entry.subclusterAllocated != 1<<l2SubclusterCount-1:
+		// Extended-L2 entry with at least one subcluster that isn't
+		// plainly allocated: allocated, all-zeroes and unallocated
+		// subclusters each need their own handling (see
+		// readExtendedCluster), whether or not entry.offset is 0.
+		return readExtendedCluster(image, cfg, entry, clusterIdx, out)
+	case entry.offset == 0:
+		// Unallocated (non-extended L2): no backing file means this
+		// reads as zero; with one, the backing image holds whatever
+		// data used to be here.
+		if cfg.backing == nil {
+			for i := range out {
+				out[i] = 0
+			}
+			return nil
+		}
+
+		for i := range out {
+			out[i] = 0
+		}
+		guestOffset := int64(clusterIdx) * int64(cfg.clusterSize)
+		if _, err := cfg.backing.ReadAt(out, guestOffset); err != nil && err != io.EOF {
 			return err
 		}
 	default:
-		if _, err := r.image.Seek(entry.offset, io.SeekStart); err != nil {
+		if _, err := image.Seek(entry.offset, io.SeekStart); err != nil {
 			return err
 		}
-		if _, err := io.ReadFull(r.image, r.currentData); err != nil {
+		if _, err := io.ReadFull(image, out); err != nil {
 			return err
 		}
 	}
 
-	r.currentOffset = 0
+	return nil
+}
+
+// readExtendedCluster fills out from an extended-L2 entry whose
+// subclusters aren't uniformly allocated. Each subcluster is decoded
+// according to its own state: allocated subclusters are read from
+// entry.offset, all-zeroes subclusters always read as zero regardless
+// of any backing file, and unallocated subclusters (neither bit set)
+// fall through to the backing chain at the matching guest offset, same
+// as an unallocated whole cluster would.
+func readExtendedCluster(image io.ReadSeeker, cfg qcow2Config, entry l2Entry, clusterIdx int, out []byte) error {
+	subclusterSize := cfg.clusterSize / l2SubclusterCount
+
+	for i := 0; i < l2SubclusterCount; i++ {
+		start, end := i*subclusterSize, (i+1)*subclusterSize
+
+		switch {
+		case entry.subclusterAllocated&(1<<i) != 0:
+			if _, err := image.Seek(entry.offset+int64(start), io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(image, out[start:end]); err != nil {
+				return err
+			}
+
+		case entry.subclusterAllZeroes&(1<<i) != 0:
+			for j := start; j < end; j++ {
+				out[j] = 0
+			}
+
+		default:
+			for j := start; j < end; j++ {
+				out[j] = 0
+			}
+			if cfg.backing == nil {
+				continue
+			}
+			guestOffset := int64(clusterIdx)*int64(cfg.clusterSize) + int64(start)
+			if _, err := cfg.backing.ReadAt(out[start:end], guestOffset); err != nil && err != io.EOF {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// advanceCluster moves r onto the next cluster, reloading the L2 table
+// if the cursor just crossed into a new one, and returns that cluster's
+// entry. It does not touch currentData/currentOffset; callers decide how
+// to materialize the cluster.
+func advanceCluster(r *qcow2Reader) (l2Entry, error) {
+	r.currentCluster++
+	if r.currentCluster == r.nClusters {
+		return l2Entry{}, io.EOF
+	}
+
+	// If reader has moved from one L2 table to another (including a jump
+	// made by Seek), parse the new table
+	if l2TableIdx := r.currentCluster / r.l2TableSize; l2TableIdx != r.currentL2TableIdx {
+		entries, err := parseL2Table(r.image, r.qcow2Config, l2TableIdx)
+		if err != nil {
+			return l2Entry{}, err
+		}
+		r.currentL2Table = entries
+		r.currentL2TableIdx = l2TableIdx
+	}
+
+	return r.currentL2Table[r.currentCluster%r.l2TableSize], nil
+}
+
+func fillNextCluster(r *qcow2Reader) error {
+	entry, err := advanceCluster(r)
+	if err != nil {
+		return err
+	}
+
+	if err := readCluster(r.image, r.qcow2Config, entry, r.currentCluster, r.currentData); err != nil {
+		return err
+	}
+
+	// Normally the cursor lands at the start of the freshly loaded
+	// cluster, but a preceding Seek may have targeted a byte partway
+	// through it.
+	r.currentOffset = r.seekOffset
+	r.seekOffset = 0
 	return nil
 }
 
@@ -335,12 +646,160 @@ func (r *qcow2Reader) Read(p []byte) (retN int, retErr error) {
 	n := min(r.clusterSize-r.currentOffset, len(p))
 	copy(p, r.currentData[r.currentOffset:r.currentOffset+n])
 	r.currentOffset += n
+	r.pos += int64(n)
 	return n, nil
 }
 
-// NewReader takes a QCOW2 image and produces reader with raw data.
+// Seek implements io.Seeker. The underlying cursor only tracks whole
+// clusters, so a Seek to a new cluster just points it at the right one;
+// the actual L2 lookup and cluster decode happen lazily on the next Read
+// or WriteTo, same as for sequential reads. The position Seek returns,
+// and that later Reads resume from, is exact down to the byte.
+func (r *qcow2Reader) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = r.pos
+	case io.SeekEnd:
+		base = int64(r.nClusters) * int64(r.clusterSize)
+	default:
+		return 0, errors.New("qcow2: invalid whence")
+	}
+
+	target := base + offset
+	if target < 0 {
+		return 0, errors.New("qcow2: negative position")
+	}
+
+	clusterIdx := int(target / int64(r.clusterSize))
+	withinCluster := int(target % int64(r.clusterSize))
+
+	// currentData only holds currentCluster while it is partly read;
+	// after a deferred Seek or WriteTo it may hold another cluster.
+	if clusterIdx == r.currentCluster && r.currentOffset < r.clusterSize {
+		r.currentOffset = withinCluster
+	} else {
+		r.currentCluster = clusterIdx - 1
+		r.currentOffset = r.clusterSize
+		r.seekOffset = withinCluster
+	}
+
+	r.pos = target
+	return target, nil
+}
+
+// writeCluster writes clusterIdx's decoded contents, described by entry,
+// straight to dst: io.CopyN from the image for uncompressed clusters,
+// a shared zero buffer (or a hole, via Seek, on a destination that
+// supports it) for all-zeroes/unallocated ones, and scratch for
+// everything that needs decoding first.
+func writeCluster(dst io.Writer, image io.ReadSeeker, cfg qcow2Config, entry l2Entry, clusterIdx int, zero, scratch []byte) (int64, error) {
+	switch {
+	case entry.allZeroes || (entry.offset == 0 && cfg.backing == nil):
+		if seeker, ok := dst.(io.Seeker); ok {
+			if _, err := seeker.Seek(int64(len(zero)), io.SeekCurrent); err != nil {
+				return 0, err
+			}
+			return int64(len(zero)), nil
+		}
+		n, err := dst.Write(zero)
+		return int64(n), err
+
+	case entry.compressed:
+		if _, err := image.Seek(entry.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		section := io.LimitReader(image, cfg.imageSize-entry.offset)
+		if err := cfg.decompressor.decompress(section, scratch); err != nil {
+			return 0, err
+		}
+		n, err := dst.Write(scratch)
+		return int64(n), err
+
+	case entry.offset == 0 || (cfg.extendedL2 && entry.subclusterAllocated != 1<<l2SubclusterCount-1):
+		// Unallocated with a backing file, or an extended-L2 entry with
+		// a mix of allocated/zero subclusters: no contiguous run we can
+		// hand to CopyN, so fall back to the generic decode path.
+		if err := readCluster(image, cfg, entry, clusterIdx, scratch); err != nil {
+			return 0, err
+		}
+		n, err := dst.Write(scratch)
+		return int64(n), err
+
+	default:
+		if _, err := image.Seek(entry.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return io.CopyN(dst, image, int64(len(zero)))
+	}
+}
+
+// WriteTo implements io.WriterTo. io.Copy prefers it over repeated Reads,
+// which lets it stream each cluster straight to dst instead of bouncing
+// it through currentData first.
+func (r *qcow2Reader) WriteTo(dst io.Writer) (int64, error) {
+	var written int64
+
+	switch {
+	case r.currentOffset < r.clusterSize:
+		// A prior partial Read already materialized the current cluster;
+		// flush what's left of it before switching to the cluster-at-a-
+		// time path below.
+		n, err := dst.Write(r.currentData[r.currentOffset:])
+		written += int64(n)
+		r.currentOffset += n
+		r.pos += int64(n)
+		if err != nil {
+			return written, err
+		}
+
+	case r.seekOffset != 0:
+		// A prior Seek landed mid-cluster but deferred the load, same as
+		// Read would. Materialize that cluster now so the mid-cluster
+		// bytes aren't dropped.
+		if err := fillNextCluster(r); err != nil {
+			return written, err
+		}
+		n, err := dst.Write(r.currentData[r.currentOffset:])
+		written += int64(n)
+		r.currentOffset += n
+		r.pos += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	zero := make([]byte, r.clusterSize)
+	scratch := make([]byte, r.clusterSize)
+
+	for {
+		entry, err := advanceCluster(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+
+		n, err := writeCluster(dst, r.image, r.qcow2Config, entry, r.currentCluster, zero, scratch)
+		written += n
+		r.pos += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	r.currentOffset = r.clusterSize
+	return written, nil
+}
+
+// NewReader takes a QCOW2 image and produces reader with raw data. Images
+// with a backing file are rejected; use NewReaderWithOptions with a
+// BackingResolver to read those.
 func NewReader(image io.ReadSeeker) (io.Reader, error) {
-	config, err := parseHeaderAndL1(image)
+	config, err := parseHeaderAndL1(image, nil, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -349,11 +808,231 @@ func NewReader(image io.ReadSeeker) (io.Reader, error) {
 		image:       image,
 		qcow2Config: config,
 		// Allocate buffers
-		currentData:    make([]byte, config.clusterSize, config.clusterSize),
-		currentL2Table: make([]l2Entry, config.l2TableSize, config.l2TableSize),
+		currentData: make([]byte, config.clusterSize, config.clusterSize),
 
 		// Prepare state to read first L2 table and first cluster on Read()
-		currentCluster: -1,
-		currentOffset:  config.clusterSize,
+		currentCluster:    -1,
+		currentL2TableIdx: -1,
+		currentOffset:     config.clusterSize,
+	}, nil
+}
+
+// Options configures the caches built by NewReaderWithOptions.
+type Options struct {
+	// L2CacheEntries bounds how many parsed L2 tables are kept in
+	// memory, keyed by their index into the L1 table. Zero disables
+	// the cache.
+	L2CacheEntries int
+
+	// ClusterCacheBytes bounds, in bytes, how much decoded cluster data
+	// is kept in memory, keyed by host offset. Zero disables the cache.
+	ClusterCacheBytes int
+
+	// BackingResolver opens the backing file referenced by the image's
+	// header, if any. If the header references a backing file and
+	// BackingResolver is nil, NewReaderWithOptions fails.
+	BackingResolver BackingResolver
+}
+
+// Default cache sizes used by NewImage. Decompression is by far the most
+// expensive step in reading a cluster, so it's worth caching generously.
+const (
+	defaultL2CacheEntries    = 32
+	defaultClusterCacheBytes = 64 * 1024 * 1024
+)
+
+// Image provides random access to the decoded contents of a QCOW2 image,
+// for consumers such as range-serving HTTP handlers or disk image
+// inspectors that cannot afford to buffer the whole decoded image and
+// need io.ReaderAt rather than the single cursor that qcow2Reader's
+// Read and Seek move.
+//
+// An Image is safe for concurrent use: parsing an L2 table or decoding a
+// cluster on a cache miss is serialized with a mutex, since both share
+// the underlying image handle and decompressor.
+type Image struct {
+	image io.ReadSeeker
+
+	qcow2Config
+
+	mu       sync.Mutex
+	l2Tables *lruCache[int, []l2Entry]
+	clusters *lruCache[int64, []byte]
+
+	// current position for Read/Seek
+	offset int64
+}
+
+// NewImage takes a QCOW2 image and produces an Image that supports
+// random access via ReadAt and Seek, in addition to sequential Read. It
+// uses reasonable default cache sizes; use NewReaderWithOptions to tune
+// them.
+func NewImage(image io.ReadSeeker) (*Image, error) {
+	return NewReaderWithOptions(image, Options{
+		L2CacheEntries:    defaultL2CacheEntries,
+		ClusterCacheBytes: defaultClusterCacheBytes,
+	})
+}
+
+// NewReaderWithOptions is like NewImage, but lets callers size the
+// L2-table and decoded-cluster caches, which is worthwhile for images
+// with many compressed clusters or workloads that scan sparsely (e.g.
+// partition table + filesystem superblocks) and would otherwise re-parse
+// or re-inflate the same data repeatedly.
+func NewReaderWithOptions(image io.ReadSeeker, opts Options) (*Image, error) {
+	return newReaderWithOptions(image, opts, 0)
+}
+
+// newReaderWithOptions is NewReaderWithOptions plus the backing-chain
+// depth, so parseHeaderAndL1 can thread it through recursive backing
+// file resolution without exposing it in the public Options.
+func newReaderWithOptions(image io.ReadSeeker, opts Options, depth int) (*Image, error) {
+	config, err := parseHeaderAndL1(image, opts.BackingResolver, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		image:       image,
+		qcow2Config: config,
+		l2Tables:    newLRUCache[int, []l2Entry](opts.L2CacheEntries, func([]l2Entry) int { return 1 }),
+		clusters:    newLRUCache[int64, []byte](opts.ClusterCacheBytes, func(data []byte) int { return len(data) }),
 	}, nil
 }
+
+// Size returns the size in bytes of the image's decoded (virtual) contents.
+func (im *Image) Size() int64 {
+	return int64(im.nClusters) * int64(im.clusterSize)
+}
+
+// l2Table returns the parsed L2 table for l2TableIdx, parsing and caching
+// it on first use.
+func (im *Image) l2Table(l2TableIdx int) ([]l2Entry, error) {
+	if entries, ok := im.l2Tables.get(l2TableIdx); ok {
+		return entries, nil
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	// Another call may have parsed it while we were waiting for the lock.
+	if entries, ok := im.l2Tables.get(l2TableIdx); ok {
+		return entries, nil
+	}
+
+	entries, err := parseL2Table(im.image, im.qcow2Config, l2TableIdx)
+	if err != nil {
+		return nil, err
+	}
+	im.l2Tables.add(l2TableIdx, entries)
+	return entries, nil
+}
+
+// cluster returns the decoded contents of clusterIdx, described by entry,
+// parsing and caching it (keyed by host offset) on first use. All-zeroes
+// and unallocated clusters are not cached here. Unallocated clusters are
+// read through the backing image's ReadAt each time; the backing image
+// is opened with both of its caches disabled.
+func (im *Image) cluster(entry l2Entry, clusterIdx int) ([]byte, error) {
+	if entry.allZeroes || entry.offset == 0 {
+		data := make([]byte, im.clusterSize)
+		return data, readCluster(im.image, im.qcow2Config, entry, clusterIdx, data)
+	}
+
+	if data, ok := im.clusters.get(entry.offset); ok {
+		return data, nil
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if data, ok := im.clusters.get(entry.offset); ok {
+		return data, nil
+	}
+
+	data := make([]byte, im.clusterSize)
+	if err := readCluster(im.image, im.qcow2Config, entry, clusterIdx, data); err != nil {
+		return nil, err
+	}
+	im.clusters.add(entry.offset, data)
+	return data, nil
+}
+
+// ReadAt implements io.ReaderAt. It decodes only the clusters that
+// intersect [off, off+len(p)).
+func (im *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("qcow2: negative offset")
+	}
+	if off >= im.Size() {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		clusterIdx := int(pos / int64(im.clusterSize))
+		if clusterIdx >= im.nClusters {
+			break
+		}
+		clusterOffset := int(pos % int64(im.clusterSize))
+
+		entries, err := im.l2Table(clusterIdx / im.l2TableSize)
+		if err != nil {
+			return n, err
+		}
+		entry := entries[clusterIdx%im.l2TableSize]
+
+		data, err := im.cluster(entry, clusterIdx)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], data[clusterOffset:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker, for callers of Read that want to reposition.
+func (im *Image) Seek(offset int64, whence int) (int64, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = im.offset + offset
+	case io.SeekEnd:
+		newOffset = im.Size() + offset
+	default:
+		return 0, errors.New("qcow2: invalid whence")
+	}
+	if newOffset < 0 {
+		return 0, errors.New("qcow2: negative position")
+	}
+
+	im.offset = newOffset
+	return newOffset, nil
+}
+
+// Read implements io.Reader on top of ReadAt, advancing the position set
+// by Seek.
+func (im *Image) Read(p []byte) (int, error) {
+	im.mu.Lock()
+	offset := im.offset
+	im.mu.Unlock()
+
+	n, err := im.ReadAt(p, offset)
+
+	im.mu.Lock()
+	im.offset += int64(n)
+	im.mu.Unlock()
+
+	return n, err
+}
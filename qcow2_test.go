@@ -1,6 +1,8 @@
 package qcow2
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"os"
 	"os/exec"
@@ -20,6 +22,16 @@ func makeQcow2(t *testing.T, name string, data []byte) {
 	require.NoError(t, os.Remove("testdata/"+name+".tmp"))
 }
 
+// makeQcow2Zstd is makeQcow2 but forces zstd cluster compression, which
+// requires the version-3 on-disk format.
+func makeQcow2Zstd(t *testing.T, name string, data []byte) {
+	require.NoError(t, os.WriteFile("testdata/"+name+".tmp", data, 0o644))
+	require.NoError(t, exec.Command("qemu-img", "convert", "-c", "-f", "raw", "-O", "qcow2",
+		"-o", "cluster_size=512,compat=1.1,compression_type=zstd",
+		"testdata/"+name+".tmp", "testdata/"+name+".qcow2").Run())
+	require.NoError(t, os.Remove("testdata/"+name+".tmp"))
+}
+
 // https://github.com/dominikh/go-tools/issues/633
 var skip = func(t *testing.T) {
 	t.SkipNow()
@@ -58,6 +70,38 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestCreateZstdTestFile(t *testing.T) {
+	// This test was used to create test file for TestParseZstd().
+	// Do not reenable unless really needed, as it requires qemu-img.
+	skip(t)
+
+	buf := make([]byte, rawSize)
+	for i := 0; i < len(buf)/2; i++ {
+		buf[2*i] = byte(i / 256)
+		buf[2*i+1] = byte(i % 256)
+	}
+	makeQcow2Zstd(t, "small-zstd", buf)
+}
+
+// Same content as TestParse, but compressed with zstd rather than zlib.
+func TestParseZstd(t *testing.T) {
+	fh, err := os.Open("testdata/small-zstd.qcow2")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	qcow2Reader, err := NewReader(fh)
+	require.NoError(t, err)
+
+	buf, err := io.ReadAll(qcow2Reader)
+	require.NoError(t, err)
+
+	require.Equal(t, rawSize, len(buf))
+	for i := 0; i < len(buf)/2; i++ {
+		require.Equal(t, byte(i/256), buf[2*i])
+		require.Equal(t, byte(i%256), buf[2*i+1])
+	}
+}
+
 func TestCreateEmptyFile(t *testing.T) {
 	// This test was used to create test file for TestParseEmpty()
 	// Do not reenable unless really needed, as it requires qemu-img.
@@ -83,3 +127,300 @@ func TestParseEmpty(t *testing.T) {
 		require.Equal(t, byte(0), buf[i])
 	}
 }
+
+// Seeking to a byte partway into a cluster and then letting io.Copy
+// dispatch to WriteTo (the "resume an interrupted transfer" use case)
+// must resume at that exact byte, not restream the whole cluster from
+// its start.
+func TestSeekThenWriteTo(t *testing.T) {
+	fh, err := os.Open("testdata/small.qcow2")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	reader, err := NewReader(fh)
+	require.NoError(t, err)
+
+	const seekTo = 50
+	_, err = reader.(io.Seeker).Seek(seekTo, io.SeekStart)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, reader)
+	require.NoError(t, err)
+	require.Equal(t, int64(rawSize-seekTo), n)
+
+	fh2, err := os.Open("testdata/small.qcow2")
+	require.NoError(t, err)
+	defer fh2.Close()
+
+	full, err := NewReader(fh2)
+	require.NoError(t, err)
+	all, err := io.ReadAll(full)
+	require.NoError(t, err)
+
+	require.Equal(t, all[seekTo:], buf.Bytes())
+}
+
+// selfBackingImage builds a minimal (empty, version-2) qcow2 header whose
+// backing file name points back at itself, to test cycle handling
+// without needing a qemu-img fixture.
+func selfBackingImage(backingName string) []byte {
+	header := make([]byte, 72)
+	copy(header[0:4], []byte{'Q', 'F', 'I', 0xfb})
+	binary.BigEndian.PutUint32(header[4:8], 2)                          // version
+	binary.BigEndian.PutUint64(header[8:16], 72)                        // backing file name offset
+	binary.BigEndian.PutUint32(header[16:20], uint32(len(backingName))) // backing file name size
+	binary.BigEndian.PutUint32(header[20:24], 9)                        // cluster_bits: 512-byte clusters
+	// virtual disk size, encryption method, L1 table size/offset are
+	// left zero: an empty image with no clusters and no L1 table.
+	return append(header, []byte(backingName)...)
+}
+
+type loopingResolver struct{ image []byte }
+
+func (r loopingResolver) Open(name string) (io.ReadSeeker, error) {
+	return bytes.NewReader(r.image), nil
+}
+
+// A backing file chain that loops back on itself must fail with an
+// error, not recurse until the stack overflows.
+func TestBackingChainCycleIsRejected(t *testing.T) {
+	image := selfBackingImage("self")
+
+	_, err := NewReaderWithOptions(bytes.NewReader(image), Options{
+		BackingResolver: loopingResolver{image: image},
+	})
+	require.Error(t, err)
+}
+
+// oneClusterBackingImage builds a minimal, non-extended-L2, version-2
+// qcow2 image with a single allocated 512-byte cluster filled with
+// fill, and no backing file of its own.
+func oneClusterBackingImage(fill byte) []byte {
+	const (
+		clusterSize   = 512
+		l2TableOffset = 512 // L1/L2 entry offsets are masked to bits 9-55, so must be cluster-aligned
+		clusterOffset = 1024
+	)
+
+	img := make([]byte, clusterOffset+clusterSize)
+
+	header := img[0:72]
+	copy(header[0:4], []byte{'Q', 'F', 'I', 0xfb})
+	binary.BigEndian.PutUint32(header[4:8], 2)             // version
+	binary.BigEndian.PutUint32(header[20:24], 9)           // cluster_bits: 512-byte clusters
+	binary.BigEndian.PutUint64(header[24:32], clusterSize) // virtual disk size: one cluster
+	binary.BigEndian.PutUint32(header[36:40], 1)           // L1 table size: one entry
+	binary.BigEndian.PutUint64(header[40:48], 72)          // L1 table offset
+
+	binary.BigEndian.PutUint64(img[72:80], l2TableOffset)                         // L1 entry: L2 table
+	binary.BigEndian.PutUint64(img[l2TableOffset:l2TableOffset+8], clusterOffset) // L2 entry: cluster data
+
+	for i := 0; i < clusterSize; i++ {
+		img[clusterOffset+i] = fill
+	}
+	return img
+}
+
+// unallocatedOverlayImage builds a minimal, non-extended-L2, version-2
+// qcow2 image with a backing file whose one L1 entry is 0 ("no L2
+// table"), so the overlay's single cluster is unallocated and must be
+// served entirely from the backing image.
+func unallocatedOverlayImage(backingName string) []byte {
+	const clusterSize = 512
+
+	img := make([]byte, 200)
+
+	header := img[0:72]
+	copy(header[0:4], []byte{'Q', 'F', 'I', 0xfb})
+	binary.BigEndian.PutUint32(header[4:8], 2)                          // version
+	binary.BigEndian.PutUint64(header[8:16], 160)                       // backing file name offset
+	binary.BigEndian.PutUint32(header[16:20], uint32(len(backingName))) // backing file name size
+	binary.BigEndian.PutUint32(header[20:24], 9)                        // cluster_bits: 512-byte clusters
+	binary.BigEndian.PutUint64(header[24:32], clusterSize)              // virtual disk size: one cluster
+	binary.BigEndian.PutUint32(header[36:40], 1)                        // L1 table size: one entry
+	binary.BigEndian.PutUint64(header[40:48], 80)                       // L1 table offset
+
+	// The L1 entry at offset 80 is left zero: no L2 table, so the
+	// cluster it would cover is unallocated.
+
+	copy(img[160:], backingName)
+	return img
+}
+
+// An unallocated cluster on a standard (non-extended) L2 entry must
+// read from the backing image, not as zero.
+func TestReadUnallocatedClusterFromBacking(t *testing.T) {
+	const fill = 0xcc
+
+	backing := oneClusterBackingImage(fill)
+	overlay := unallocatedOverlayImage("backing")
+
+	im, err := NewReaderWithOptions(bytes.NewReader(overlay), Options{
+		BackingResolver: loopingResolver{image: backing},
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, 512)
+	_, err = im.ReadAt(buf, 0)
+	require.NoError(t, err)
+
+	for i, b := range buf {
+		require.Equal(t, byte(fill), b, "byte %d", i)
+	}
+}
+
+// extendedL2MixedOverlay builds a version-3, extended-L2 qcow2 image
+// whose single cluster has subcluster 0 explicitly marked all-zeroes
+// and every other subcluster unallocated, with the entry's own offset
+// at 0 throughout: the on-disk case from the backing-delegation bug,
+// where conflating "all-zeroes" with "unallocated" either zeroes
+// backing data or serves backing data that should read as zero.
+func extendedL2MixedOverlay(backingName string) []byte {
+	const (
+		clusterSize   = 512
+		l2TableOffset = 512
+	)
+
+	img := make([]byte, 700)
+
+	header := img[0:72]
+	copy(header[0:4], []byte{'Q', 'F', 'I', 0xfb})
+	binary.BigEndian.PutUint32(header[4:8], 3)                          // version
+	binary.BigEndian.PutUint64(header[8:16], 600)                       // backing file name offset
+	binary.BigEndian.PutUint32(header[16:20], uint32(len(backingName))) // backing file name size
+	binary.BigEndian.PutUint32(header[20:24], 9)                        // cluster_bits: 512-byte clusters
+	binary.BigEndian.PutUint64(header[24:32], clusterSize)              // virtual disk size: one cluster
+	binary.BigEndian.PutUint32(header[36:40], 1)                        // L1 table size: one entry
+	binary.BigEndian.PutUint64(header[40:48], 104)                      // L1 table offset
+
+	v3Header := img[72:104]
+	binary.BigEndian.PutUint64(v3Header[0:8], incFeatExtendedL2EntriesBit) // incompatible features
+	binary.BigEndian.PutUint32(v3Header[28:32], 104)                       // header length
+
+	binary.BigEndian.PutUint64(img[104:112], l2TableOffset) // L1 entry: L2 table
+
+	// Extended L2 entry: descriptor word is all zero (offset 0, not
+	// compressed, not whole-cluster all-zeroes), and the subcluster
+	// bitmap marks only subcluster 0 as all-zeroes, leaving every other
+	// subcluster unallocated.
+	binary.BigEndian.PutUint64(img[l2TableOffset+8:l2TableOffset+16], uint64(1)<<32)
+
+	copy(img[600:], backingName)
+
+	return img
+}
+
+// An extended-L2 entry must delegate each subcluster to the right
+// source individually: an explicit all-zeroes subcluster always reads
+// as zero, even where the backing image holds non-zero data, while an
+// unallocated subcluster still reads from backing.
+func TestReadExtendedClusterMixedWithBacking(t *testing.T) {
+	const fill = 0xcc
+	const subclusterSize = 512 / 32
+
+	backing := oneClusterBackingImage(fill)
+	overlay := extendedL2MixedOverlay("backing")
+
+	im, err := NewReaderWithOptions(bytes.NewReader(overlay), Options{
+		BackingResolver: loopingResolver{image: backing},
+	})
+	require.NoError(t, err)
+
+	buf := make([]byte, 512)
+	_, err = im.ReadAt(buf, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < subclusterSize; i++ {
+		require.Equal(t, byte(0), buf[i], "subcluster 0 byte %d should read as explicit zero", i)
+	}
+	for i := subclusterSize; i < len(buf); i++ {
+		require.Equal(t, byte(fill), buf[i], "unallocated subcluster byte %d should read from backing", i)
+	}
+
+	// A second Image read end to end through its sequential Read (which
+	// goes through ReadAt and readCluster) must see the same result.
+	reader, err := NewReaderWithOptions(bytes.NewReader(overlay), Options{
+		BackingResolver: loopingResolver{image: backing},
+	})
+	require.NoError(t, err)
+
+	all, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, buf, all)
+}
+
+// Per qcow2.txt's "Subcluster allocation metadata" layout, the extended
+// L2 bitmap is two 32-bit planes (allocation in the low bits, all-zeroes
+// in the high bits), not 32 interleaved 2-bit fields.
+func TestParseSubclusterBitmap(t *testing.T) {
+	allocated, allZeroes, err := parseSubclusterBitmap(1<<0 | 1<<5 | 1<<(32+1) | 1<<(32+31))
+	require.NoError(t, err)
+	require.Equal(t, uint32(1<<0|1<<5), allocated)
+	require.Equal(t, uint32(1<<1|1<<31), allZeroes)
+
+	_, _, err = parseSubclusterBitmap(1<<3 | 1<<(32+3))
+	require.Error(t, err)
+}
+
+// expectedSmallByte reproduces the pattern TestCreateTestFile wrote into
+// testdata/small.qcow2, so random-access tests can check arbitrary
+// offsets without reading the whole image first.
+func expectedSmallByte(offset int) byte {
+	i := offset / 2
+	if offset%2 == 0 {
+		return byte(i / 256)
+	}
+	return byte(i % 256)
+}
+
+// ReadAt must return the right bytes at offsets that straddle a cluster
+// boundary and ones that don't, and io.EOF for a read that runs past the
+// end of the image.
+func TestImageReadAt(t *testing.T) {
+	fh, err := os.Open("testdata/small.qcow2")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	im, err := NewImage(fh)
+	require.NoError(t, err)
+	require.Equal(t, int64(rawSize), im.Size())
+
+	for _, start := range []int{0, 1, 511, 512, 513, rawSize - 10} {
+		buf := make([]byte, 20)
+		n, err := im.ReadAt(buf, int64(start))
+		if start+len(buf) > rawSize {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+
+		for i := 0; i < n; i++ {
+			require.Equal(t, expectedSmallByte(start+i), buf[i], "byte at offset %d", start+i)
+		}
+	}
+}
+
+// Seek repositions the cursor Read advances from, the same as on a
+// regular file.
+func TestImageSeekThenRead(t *testing.T) {
+	fh, err := os.Open("testdata/small.qcow2")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	im, err := NewImage(fh)
+	require.NoError(t, err)
+
+	const seekTo = 600
+	pos, err := im.Seek(seekTo, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(seekTo), pos)
+
+	buf, err := io.ReadAll(im)
+	require.NoError(t, err)
+	require.Equal(t, rawSize-seekTo, len(buf))
+
+	for i, b := range buf {
+		require.Equal(t, expectedSmallByte(seekTo+i), b, "byte at offset %d", seekTo+i)
+	}
+}